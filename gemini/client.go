@@ -1,8 +1,9 @@
 package gemini
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
@@ -13,8 +14,15 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/time/rate"
 )
 
+// ErrCanceled is returned by the *Context variants of GenerateContent,
+// GenerateContentStream, BatchExecute, and ChatSession's equivalents when
+// the caller's context is canceled or exceeds its deadline.
+var ErrCanceled = errors.New("gemini: request canceled")
+
 type GeminiClient struct {
 	Client      *http.Client
 	AccessToken string
@@ -24,9 +32,32 @@ type GeminiClient struct {
 	Lock        sync.Mutex
 	Cookies     []*http.Cookie
 	Proxy       string
+
+	// Jar persists cookies across restarts and receives refreshed cookies
+	// from the background rotation goroutine started by StartCookieRotation.
+	// It is nil unless the client was created with NewClientWithJar or one
+	// was attached with WithCookieStore.
+	Jar CookieJar
+
+	// RetryPolicy configures automatic retry of transient errors (ErrorCode
+	// 1013, 1037) surfaced as *APIError from BatchExecuteContext and
+	// GenerateContentStreamContext. The zero value disables retries.
+	RetryPolicy RetryPolicy
+
+	// limiter and sem bound outgoing request rate and concurrency when
+	// configured via WithRateLimit/WithMaxConcurrent. Both are nil (no
+	// bound) unless set at construction.
+	limiter *rate.Limiter
+	sem     chan struct{}
+
+	rotateCancel context.CancelFunc
 }
 
-func NewClient(secure1PSID, secure1PSIDTS string, proxyURL string) (*GeminiClient, error) {
+// NewClient creates a GeminiClient authenticated with the given
+// __Secure-1PSID/__Secure-1PSIDTS cookie values, optionally routed through
+// proxyURL, and configured by any ClientOptions passed in opts (see
+// WithRateLimit, WithMaxConcurrent).
+func NewClient(secure1PSID, secure1PSIDTS string, proxyURL string, opts ...ClientOption) (*GeminiClient, error) {
 	jar, err := cookiejar.New(nil)
 	if err != nil {
 		return nil, err
@@ -61,29 +92,77 @@ func NewClient(secure1PSID, secure1PSIDTS string, proxyURL string) (*GeminiClien
 	jar.SetCookies(uGoogle, cookies)
 	jar.SetCookies(uGemini, cookies)
 
-	return &GeminiClient{
+	c := &GeminiClient{
 		Client:  client,
 		ReqID:   rand.Intn(90000) + 10000,
 		Cookies: cookies,
 		Proxy:   proxyURL,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
 }
 
 func (c *GeminiClient) Init() error {
 	c.Lock.Lock()
-	defer c.Lock.Unlock()
-
 	snlm0e, bl, sid, err := GetAccessToken(c.Client)
 	if err != nil {
+		c.Lock.Unlock()
 		return err
 	}
 	c.AccessToken = snlm0e
 	c.BuildLabel = bl
 	c.SessionID = sid
-	return nil
+	c.Lock.Unlock()
+
+	return c.persistSession(context.Background())
 }
 
-func (c *GeminiClient) BatchExecute(payloads []RPCData) error {
+// syncCookiesFromTransportJar refreshes c.Cookies from the http.Client's
+// cookie jar, which Google may have updated via Set-Cookie headers on the
+// response, and persists the session through c.Jar if one is configured.
+// BatchExecuteContext and GenerateContentStreamContext both need this after
+// every request.
+func (c *GeminiClient) syncCookiesFromTransportJar(ctx context.Context) {
+	if c.Client.Jar == nil {
+		return
+	}
+
+	u, _ := url.Parse(EndpointGoogle)
+	c.Lock.Lock()
+	c.Cookies = c.Client.Jar.Cookies(u)
+	c.Lock.Unlock()
+
+	if c.Jar != nil {
+		_ = c.persistSession(ctx)
+	}
+}
+
+// BatchExecute sends payloads to EndpointBatchExec and returns the raw
+// response body, so typed RPC wrappers (gems, chat history) can decode it
+// into their own result types instead of hand-parsing the payload twice.
+func (c *GeminiClient) BatchExecute(payloads []RPCData) (string, error) {
+	return c.BatchExecuteContext(context.Background(), payloads)
+}
+
+// BatchExecuteContext is BatchExecute with a caller-supplied context, which
+// bounds the request and is translated into ErrCanceled on cancellation.
+func (c *GeminiClient) BatchExecuteContext(ctx context.Context, payloads []RPCData) (string, error) {
+	if err := c.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer c.release()
+
+	return c.batchExecuteLocked(ctx, payloads)
+}
+
+// batchExecuteLocked is BatchExecuteContext without the acquire/release pair,
+// for callers that already hold a concurrency slot (e.g.
+// GenerateContentStreamContext dispatching the bard_activity_enabled RPCs
+// for WithFiles) and would otherwise deadlock re-acquiring c.sem.
+func (c *GeminiClient) batchExecuteLocked(ctx context.Context, payloads []RPCData) (string, error) {
 	c.Lock.Lock()
 	reqID := c.ReqID
 	c.ReqID += 100000
@@ -119,31 +198,52 @@ func (c *GeminiClient) BatchExecute(payloads []RPCData) error {
 	}
 	reqURL.RawQuery = q.Encode()
 
-	req, err := http.NewRequest("POST", reqURL.String(), strings.NewReader(form.Encode()))
-	if err != nil {
-		return err
-	}
+	var body string
+	err := c.withRetry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, "POST", reqURL.String(), strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
 
-	for k, v := range HeadersGemini {
-		req.Header.Set(k, v)
-	}
+		for k, v := range HeadersGemini {
+			req.Header.Set(k, v)
+		}
 
-	resp, err := c.Client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+		resp, err := c.Client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ErrCanceled
+			}
+			return err
+		}
+		defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("batch execute failed with status: %s", resp.Status)
-	}
+		if resp.StatusCode != 200 {
+			return apiErrorFromResponse(resp)
+		}
+
+		c.syncCookiesFromTransportJar(ctx)
+
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ErrCanceled
+			}
+			return err
+		}
 
-	if c.Client.Jar != nil {
-		u, _ := url.Parse(EndpointGoogle)
-		c.Cookies = c.Client.Jar.Cookies(u)
+		if apiErr, ok := apiErrorFromBody(string(respBody)); ok {
+			return apiErr
+		}
+
+		body = string(respBody)
+		return nil
+	})
+	if err != nil {
+		return "", err
 	}
 
-	return nil
+	return body, nil
 }
 
 // Option pattern for optional arguments
@@ -181,16 +281,24 @@ func WithFiles(files []interface{}) Option {
 }
 
 func (c *GeminiClient) GenerateContent(prompt string, opts ...Option) (ModelOutput, error) {
+	return c.GenerateContentContext(context.Background(), prompt, opts...)
+}
+
+// GenerateContentContext is GenerateContent with a caller-supplied context,
+// which bounds the whole streamed exchange and is translated into
+// ErrCanceled on cancellation, instead of relying solely on the http.Client's
+// fixed 300s timeout.
+func (c *GeminiClient) GenerateContentContext(ctx context.Context, prompt string, opts ...Option) (ModelOutput, error) {
 	// Simple wrapper around stream that collects the last output
 	var lastOutput ModelOutput
 	// We use a channel to collect outputs
 	outChan := make(chan ModelOutput)
-	errChan := make(chan error)
+	errChan := make(chan error, 1)
 
 	go func() {
 		defer close(outChan)
 		defer close(errChan)
-		if err := c.GenerateContentStream(prompt, outChan, opts...); err != nil {
+		if err := c.GenerateContentStreamContext(ctx, prompt, outChan, opts...); err != nil {
 			errChan <- err
 		}
 	}()
@@ -213,6 +321,15 @@ func (c *GeminiClient) GenerateContent(prompt string, opts ...Option) (ModelOutp
 }
 
 func (c *GeminiClient) GenerateContentStream(prompt string, outChan chan<- ModelOutput, opts ...Option) error {
+	return c.GenerateContentStreamContext(context.Background(), prompt, outChan, opts...)
+}
+
+// GenerateContentStreamContext is GenerateContentStream with a
+// caller-supplied context. The context is threaded into the outbound HTTP
+// request and polled while draining the streaming read loop, so a caller
+// can bound a long-running Gemini stream without racing goroutines or
+// leaking channels.
+func (c *GeminiClient) GenerateContentStreamContext(ctx context.Context, prompt string, outChan chan<- ModelOutput, opts ...Option) error {
 	options := generateOptions{
 		Model: ModelUnspecified,
 	}
@@ -224,6 +341,11 @@ func (c *GeminiClient) GenerateContentStream(prompt string, outChan chan<- Model
 		return fmt.Errorf("prompt cannot be empty")
 	}
 
+	if err := c.acquire(ctx); err != nil {
+		return err
+	}
+	defer c.release()
+
 	c.Lock.Lock()
 	reqID := c.ReqID
 	c.ReqID += 100000
@@ -235,7 +357,7 @@ func (c *GeminiClient) GenerateContentStream(prompt string, outChan chan<- Model
 			RPCID:   GRPCBardActivity,
 			Payload: "[[[\"bard_activity_enabled\"]]]",
 		}
-		if err := c.BatchExecute([]RPCData{activityPayload}); err != nil {
+		if _, err := c.batchExecuteLocked(ctx, []RPCData{activityPayload}); err != nil {
 			return err
 		}
 
@@ -244,8 +366,11 @@ func (c *GeminiClient) GenerateContentStream(prompt string, outChan chan<- Model
 			if err != nil {
 				return err
 			}
-			urlStr, err := UploadFile(c.Client, file, filename)
+			urlStr, err := UploadFileContext(ctx, c.Client, file, filename)
 			if err != nil {
+				if ctx.Err() != nil {
+					return ErrCanceled
+				}
 				return err
 			}
 			reqFileData = append(reqFileData, []interface{}{
@@ -261,7 +386,7 @@ func (c *GeminiClient) GenerateContentStream(prompt string, outChan chan<- Model
 			RPCID:   GRPCBardActivity,
 			Payload: "[[[\"bard_activity_enabled\"]]]",
 		}
-		if err := c.BatchExecute([]RPCData{activityPayload}); err != nil {
+		if _, err := c.batchExecuteLocked(ctx, []RPCData{activityPayload}); err != nil {
 			return err
 		}
 	}
@@ -326,34 +451,42 @@ func (c *GeminiClient) GenerateContentStream(prompt string, outChan chan<- Model
 	}
 	reqURL.RawQuery = q.Encode()
 
-	req, err := http.NewRequest("POST", reqURL.String(), strings.NewReader(form.Encode()))
-	if err != nil {
-		return err
-	}
+	var resp *http.Response
+	err := c.withRetry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, "POST", reqURL.String(), strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
 
-	for k, v := range HeadersGemini {
-		req.Header.Set(k, v)
-	}
-	for k, v := range options.Model.Header {
-		req.Header.Set(k, v)
-	}
+		for k, v := range HeadersGemini {
+			req.Header.Set(k, v)
+		}
+		for k, v := range options.Model.Header {
+			req.Header.Set(k, v)
+		}
 
-	resp, err := c.Client.Do(req)
+		r, err := c.Client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ErrCanceled
+			}
+			return err
+		}
+
+		if r.StatusCode != 200 {
+			defer r.Body.Close()
+			return apiErrorFromResponse(r)
+		}
+
+		resp = r
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("failed to generate content, status: %s", resp.Status)
-	}
-
-	if c.Client.Jar != nil {
-		u, _ := url.Parse(EndpointGoogle)
-		c.Cookies = c.Client.Jar.Cookies(u)
-	}
-
-	reader := bufio.NewReader(resp.Body)
+	c.syncCookiesFromTransportJar(ctx)
 
 	sessionState := struct {
 		lastTexts    map[string]string
@@ -363,49 +496,32 @@ func (c *GeminiClient) GenerateContentStream(prompt string, outChan chan<- Model
 		lastThoughts: make(map[string]string),
 	}
 
-	buffer := ""
-	buf := make([]byte, 1024)
-
-	for {
-		n, err := reader.Read(buf)
-		if n > 0 {
-			chunk := string(buf[:n])
-			buffer += chunk
-
-			if strings.HasPrefix(buffer, ")]}'") {
-				buffer = buffer[4:]
-				buffer = strings.TrimLeft(buffer, " \t\n\r")
-			}
-
-			frames, remaining := ParseResponseByFrame(buffer)
-			buffer = remaining
-
-			for _, frame := range frames {
-				outputs, err := processFrame(frame, options.Chat, sessionState.lastTexts, sessionState.lastThoughts, c.Proxy)
-				if err != nil {
-					continue
-				}
-				for _, out := range outputs {
-					outChan <- out
-				}
-			}
+	scanner := NewFrameScanner(resp.Body)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ErrCanceled
 		}
-		if err == io.EOF {
-			break
+		if apiErr, ok := errorFromFrame(scanner.Frame()); ok {
+			return apiErr
 		}
+		outputs, err := processFrame(scanner.Frame(), options.Chat, sessionState.lastTexts, sessionState.lastThoughts, c.Proxy)
 		if err != nil {
-			return err
+			continue
+		}
+		for _, out := range outputs {
+			select {
+			case outChan <- out:
+			case <-ctx.Done():
+				return ErrCanceled
+			}
 		}
 	}
 
-	if buffer != "" {
-		frames, _ := ParseResponseByFrame(buffer)
-		for _, frame := range frames {
-			outputs, _ := processFrame(frame, options.Chat, sessionState.lastTexts, sessionState.lastThoughts, c.Proxy)
-			for _, out := range outputs {
-				outChan <- out
-			}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return ErrCanceled
 		}
+		return err
 	}
 
 	return nil
@@ -587,6 +703,11 @@ func (c *GeminiClient) StartChat(opts ...Option) *ChatSession {
 }
 
 func (s *ChatSession) SendMessage(prompt string, opts ...Option) (ModelOutput, error) {
+	return s.SendMessageContext(context.Background(), prompt, opts...)
+}
+
+// SendMessageContext is SendMessage with a caller-supplied context.
+func (s *ChatSession) SendMessageContext(ctx context.Context, prompt string, opts ...Option) (ModelOutput, error) {
     newOpts := []Option{
         WithModel(s.Model),
         WithChat(s),
@@ -596,7 +717,7 @@ func (s *ChatSession) SendMessage(prompt string, opts ...Option) (ModelOutput, e
     }
     newOpts = append(newOpts, opts...)
 
-	output, err := s.Client.GenerateContent(prompt, newOpts...)
+	output, err := s.Client.GenerateContentContext(ctx, prompt, newOpts...)
     if err == nil {
         if len(output.Metadata) >= 3 {
             s.CID = output.Metadata[0]
@@ -609,6 +730,11 @@ func (s *ChatSession) SendMessage(prompt string, opts ...Option) (ModelOutput, e
 }
 
 func (s *ChatSession) SendMessageStream(prompt string, outChan chan<- ModelOutput, opts ...Option) error {
+	return s.SendMessageStreamContext(context.Background(), prompt, outChan, opts...)
+}
+
+// SendMessageStreamContext is SendMessageStream with a caller-supplied context.
+func (s *ChatSession) SendMessageStreamContext(ctx context.Context, prompt string, outChan chan<- ModelOutput, opts ...Option) error {
     newOpts := []Option{
         WithModel(s.Model),
         WithChat(s),
@@ -618,5 +744,5 @@ func (s *ChatSession) SendMessageStream(prompt string, outChan chan<- ModelOutpu
     }
     newOpts = append(newOpts, opts...)
 
-	return s.Client.GenerateContentStream(prompt, outChan, newOpts...)
+	return s.Client.GenerateContentStreamContext(ctx, prompt, outChan, newOpts...)
 }
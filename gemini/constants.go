@@ -48,6 +48,7 @@ const (
 	ErrorCodeUsageLimitExceeded   ErrorCode = 1037
 	ErrorCodeModelInconsistent    ErrorCode = 1050
 	ErrorCodeModelHeaderInvalid   ErrorCode = 1052
+	ErrorCodeSessionExpired       ErrorCode = 1053
 	ErrorCodeIPTemporarilyBlocked ErrorCode = 1060
 )
 
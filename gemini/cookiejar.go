@@ -0,0 +1,321 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// SessionData is the full session state a CookieJar persists: not just the
+// cookies, but the tokens GetAccessToken returns, since a client restored
+// from disk needs all of them to avoid re-hitting EndpointInit.
+type SessionData struct {
+	Cookies     map[string]string `json:"cookies"`
+	AccessToken string            `json:"access_token,omitempty"`
+	BuildLabel  string            `json:"build_label,omitempty"`
+	SessionID   string            `json:"session_id,omitempty"`
+}
+
+// CookieJar persists the session state a GeminiClient needs to survive a
+// restart, and receives any cookie refreshed by the background rotation
+// goroutine started by StartCookieRotation.
+type CookieJar interface {
+	Load(ctx context.Context) (SessionData, error)
+	Save(ctx context.Context, data SessionData) error
+}
+
+// MemoryCookieJar is a CookieJar backed by an in-process value. It is mainly
+// useful for tests and callers that manage persistence themselves.
+type MemoryCookieJar struct {
+	mu   sync.Mutex
+	data SessionData
+}
+
+// NewMemoryCookieJar creates an empty MemoryCookieJar.
+func NewMemoryCookieJar() *MemoryCookieJar {
+	return &MemoryCookieJar{data: SessionData{Cookies: map[string]string{}}}
+}
+
+func (j *MemoryCookieJar) Load(ctx context.Context) (SessionData, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return cloneSessionData(j.data), nil
+}
+
+func (j *MemoryCookieJar) Save(ctx context.Context, data SessionData) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.data = cloneSessionData(data)
+	return nil
+}
+
+// FileCookieJar is a CookieJar backed by a JSON file on disk.
+type FileCookieJar struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// NewFileCookieJar creates a FileCookieJar reading from and writing to path.
+func NewFileCookieJar(path string) *FileCookieJar {
+	return &FileCookieJar{Path: path}
+}
+
+func (j *FileCookieJar) Load(ctx context.Context) (SessionData, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	data, err := os.ReadFile(j.Path)
+	if os.IsNotExist(err) {
+		return SessionData{Cookies: map[string]string{}}, nil
+	}
+	if err != nil {
+		return SessionData{}, err
+	}
+
+	var session SessionData
+	if err := json.Unmarshal(data, &session); err != nil {
+		return SessionData{}, err
+	}
+	if session.Cookies == nil {
+		session.Cookies = map[string]string{}
+	}
+	return session, nil
+}
+
+func (j *FileCookieJar) Save(ctx context.Context, session SessionData) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(j.Path, data, 0600)
+}
+
+// KeyringCookieJar stores session state in the OS keychain/credential
+// manager under the given service and user, so it never touches disk in
+// plaintext.
+type KeyringCookieJar struct {
+	Service string
+	User    string
+}
+
+// NewKeyringCookieJar creates a KeyringCookieJar for the given service/user pair.
+func NewKeyringCookieJar(service, user string) *KeyringCookieJar {
+	return &KeyringCookieJar{Service: service, User: user}
+}
+
+func (j *KeyringCookieJar) Load(ctx context.Context) (SessionData, error) {
+	data, err := keyring.Get(j.Service, j.User)
+	if err == keyring.ErrNotFound {
+		return SessionData{Cookies: map[string]string{}}, nil
+	}
+	if err != nil {
+		return SessionData{}, err
+	}
+
+	var session SessionData
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return SessionData{}, err
+	}
+	if session.Cookies == nil {
+		session.Cookies = map[string]string{}
+	}
+	return session, nil
+}
+
+func (j *KeyringCookieJar) Save(ctx context.Context, session SessionData) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return keyring.Set(j.Service, j.User, string(data))
+}
+
+func cloneSessionData(data SessionData) SessionData {
+	out := SessionData{
+		Cookies:     make(map[string]string, len(data.Cookies)),
+		AccessToken: data.AccessToken,
+		BuildLabel:  data.BuildLabel,
+		SessionID:   data.SessionID,
+	}
+	for k, v := range data.Cookies {
+		out.Cookies[k] = v
+	}
+	return out
+}
+
+// DefaultRotationInterval is how often the background goroutine started by
+// StartCookieRotation refreshes __Secure-1PSIDTS when RotationOptions.Interval
+// is unset.
+const DefaultRotationInterval = 9 * time.Minute
+
+// defaultMaxRotationBackoff caps the exponential backoff applied after a
+// failed rotation when RotationOptions.MaxBackoff is unset.
+const defaultMaxRotationBackoff = 5 * time.Minute
+
+// RotationOptions configures the background cookie-rotation goroutine
+// started by GeminiClient.StartCookieRotation.
+type RotationOptions struct {
+	// Interval is the base delay between rotation attempts. A small jitter
+	// is added so that many client instances don't rotate in lockstep.
+	Interval time.Duration
+	// MaxBackoff caps the exponential backoff applied after a failed rotation.
+	MaxBackoff time.Duration
+}
+
+// NewClientWithJar creates a GeminiClient like NewClient, but loads its
+// session state from jar instead of raw secure1PSID/secure1PSIDTS strings,
+// and wires jar to receive any state refreshed by Init or background
+// rotation. opts is forwarded to NewClient, so a jar-backed client can still
+// be configured with WithRateLimit/WithMaxConcurrent.
+func NewClientWithJar(jar CookieJar, proxyURL string, opts ...ClientOption) (*GeminiClient, error) {
+	session, err := jar.Load(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := NewClient(session.Cookies["__Secure-1PSID"], session.Cookies["__Secure-1PSIDTS"], proxyURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.AccessToken = session.AccessToken
+	c.BuildLabel = session.BuildLabel
+	c.SessionID = session.SessionID
+	c.Jar = jar
+	return c, nil
+}
+
+// WithCookieStore attaches jar to an already-constructed client, so
+// BatchExecute, GenerateContentStream, and StartCookieRotation start
+// persisting session state through it. It returns c for chaining.
+func (c *GeminiClient) WithCookieStore(jar CookieJar) *GeminiClient {
+	c.Jar = jar
+	return c
+}
+
+// StartCookieRotation launches a background goroutine that periodically
+// calls Rotate1PSIDTS and persists the refreshed session through c.Jar, so a
+// long-running server survives Google invalidating the cookie mid-request.
+// It requires a CookieJar to have been configured via NewClientWithJar or
+// WithCookieStore.
+func (c *GeminiClient) StartCookieRotation(opts RotationOptions) error {
+	if c.Jar == nil {
+		return fmt.Errorf("cookie rotation requires a CookieJar (use NewClientWithJar or WithCookieStore)")
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultRotationInterval
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultMaxRotationBackoff
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.rotateCancel = cancel
+
+	go c.rotateLoop(ctx, opts)
+	return nil
+}
+
+// StopCookieRotation stops the background goroutine started by
+// StartCookieRotation, if one is running.
+func (c *GeminiClient) StopCookieRotation() {
+	if c.rotateCancel != nil {
+		c.rotateCancel()
+		c.rotateCancel = nil
+	}
+}
+
+func (c *GeminiClient) rotateLoop(ctx context.Context, opts RotationOptions) {
+	backoff := opts.Interval
+
+	for {
+		jitter := time.Duration(rand.Int63n(int64(opts.Interval)/4 + 1))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(opts.Interval + jitter):
+		}
+
+		if err := c.rotateAndPersist(ctx); err != nil {
+			backoff *= 2
+			if backoff > opts.MaxBackoff {
+				backoff = opts.MaxBackoff
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			continue
+		}
+
+		backoff = opts.Interval
+	}
+}
+
+// rotateAndPersist calls Rotate1PSIDTS and, on success, pushes the refreshed
+// cookie into c.Client.Jar (the rotate endpoint responds with a host-only
+// Set-Cookie for accounts.google.com, which the http.Client's own jar
+// bookkeeping never applies to google.com/gemini.google.com) and saves the
+// refreshed session state through c.Jar.
+func (c *GeminiClient) rotateAndPersist(ctx context.Context) error {
+	newPSIDTS, _, err := Rotate1PSIDTS(c.Client)
+	if err != nil {
+		return err
+	}
+	if newPSIDTS == "" {
+		return fmt.Errorf("rotation did not return a new __Secure-1PSIDTS")
+	}
+
+	c.Lock.Lock()
+	for _, ck := range c.Cookies {
+		if ck.Name == "__Secure-1PSIDTS" {
+			ck.Value = newPSIDTS
+		}
+	}
+	if jar := c.Client.Jar; jar != nil {
+		rotated := &http.Cookie{Name: "__Secure-1PSIDTS", Value: newPSIDTS, Domain: ".google.com", Path: "/"}
+		uGoogle, _ := url.Parse("https://google.com")
+		uGemini, _ := url.Parse("https://gemini.google.com")
+		jar.SetCookies(uGoogle, []*http.Cookie{rotated})
+		jar.SetCookies(uGemini, []*http.Cookie{rotated})
+	}
+	c.Lock.Unlock()
+
+	return c.persistSession(ctx)
+}
+
+// persistSession serializes c.Cookies, AccessToken, BuildLabel, and
+// SessionID under c.Lock and saves the snapshot through c.Jar. It is a
+// no-op if no jar is configured.
+func (c *GeminiClient) persistSession(ctx context.Context) error {
+	if c.Jar == nil {
+		return nil
+	}
+
+	c.Lock.Lock()
+	session := SessionData{
+		Cookies:     make(map[string]string, len(c.Cookies)),
+		AccessToken: c.AccessToken,
+		BuildLabel:  c.BuildLabel,
+		SessionID:   c.SessionID,
+	}
+	for _, ck := range c.Cookies {
+		session.Cookies[ck.Name] = ck.Value
+	}
+	c.Lock.Unlock()
+
+	return c.Jar.Save(ctx, session)
+}
@@ -1,8 +1,21 @@
 package gemini
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestParseResponseByFrame(t *testing.T) {
@@ -75,3 +88,729 @@ func TestGetDeltaByFPLen(t *testing.T) {
 		t.Errorf("Expected full 'Hello ', got '%q'", full3)
 	}
 }
+
+func TestFrameScanner(t *testing.T) {
+	input := "5\n\n[1]\n5\n\n[2]"
+	expected := []interface{}{float64(1), float64(2)}
+
+	scanner := NewFrameScanner(strings.NewReader(input))
+	var got []interface{}
+	for scanner.Scan() {
+		got = append(got, scanner.Frame())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+// buildManyFrames constructs a response body made of n small frames, used to
+// benchmark parsing of a large streamed reply.
+func buildManyFrames(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		payload := fmt.Sprintf("[%d]", i)
+		fmt.Fprintf(&b, "%d\n%s\n", len(payload)+1, payload)
+	}
+	return b.String()
+}
+
+// BenchmarkParseResponseByFrameLarge exercises the buffered parser the way
+// the old streaming loop used it: re-parsing the whole growing buffer as
+// more bytes arrive, which is O(N^2) in the number of frames.
+func BenchmarkParseResponseByFrameLarge(b *testing.B) {
+	full := buildManyFrames(2000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buffer := ""
+		for _, r := range full {
+			buffer += string(r)
+			ParseResponseByFrame(buffer)
+		}
+	}
+}
+
+// buildOneLargeFrame constructs a response body holding a single
+// length-prefixed frame of approximately n bytes, used to benchmark a
+// reply shaped as one big frame (e.g. a long generated response) instead
+// of many small ones.
+func buildOneLargeFrame(n int) string {
+	payload := "[\"" + strings.Repeat("x", n) + "\"]"
+	return fmt.Sprintf("%d\n\n%s", len(payload)+2, payload)
+}
+
+// BenchmarkFrameScannerOneLargeFrame exercises FrameScanner on a single
+// ~400KB frame delivered over many small reads. Unlike BenchmarkFrameScanner
+// (many small frames), this is the case frameNotYetComplete exists for:
+// without it, fill would re-run the buffered, regex-based
+// ParseResponseByFrame over the whole growing buffer on every read while
+// the one frame is still incomplete, which is quadratic in the frame's size.
+func BenchmarkFrameScannerOneLargeFrame(b *testing.B) {
+	full := buildOneLargeFrame(400_000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scanner := NewFrameScanner(strings.NewReader(full))
+		for scanner.Scan() {
+		}
+	}
+}
+
+// BenchmarkFrameScanner exercises the same reply through FrameScanner, which
+// parses each frame once as it completes, independent of how many frames
+// have already been consumed.
+func BenchmarkFrameScanner(b *testing.B) {
+	full := buildManyFrames(2000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scanner := NewFrameScanner(strings.NewReader(full))
+		for scanner.Scan() {
+		}
+	}
+}
+
+// TestSendChunkWithRetryResumesFromQueriedOffset simulates a chunk upload
+// that fails once the server has already received part of it, then verifies
+// the retry resends only the unreceived tail at the queried offset rather
+// than the whole chunk from the start.
+func TestSendChunkWithRetryResumesFromQueriedOffset(t *testing.T) {
+	chunk := []byte("0123456789")
+	const received = 4 // server claims it already has the first 4 bytes
+
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("X-Goog-Upload-Command") {
+		case "query":
+			w.Header().Set("X-Goog-Upload-Size-Received", fmt.Sprintf("%d", received))
+			w.WriteHeader(http.StatusOK)
+			return
+		default:
+			attempts++
+			if attempts == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			if got := r.Header.Get("X-Goog-Upload-Offset"); got != fmt.Sprintf("%d", received) {
+				t.Errorf("retry sent offset %s, want %d", got, received)
+			}
+			body := new(strings.Builder)
+			if _, err := io.Copy(body, r.Body); err != nil {
+				t.Fatalf("reading retry body: %v", err)
+			}
+			if !strings.Contains(body.String(), string(chunk[received:])) {
+				t.Errorf("retry body missing expected tail %q", chunk[received:])
+			}
+			if strings.Contains(body.String(), string(chunk[:received])) {
+				t.Errorf("retry body resent already-received prefix %q", chunk[:received])
+			}
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	u := NewUploader(server.Client(), UploadOptions{MaxRetries: 1})
+	if _, _, err := u.sendChunkWithRetry(context.Background(), server.URL, chunk, 0, true); err != nil {
+		t.Fatalf("sendChunkWithRetry returned error: %v", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts)
+	}
+}
+
+// TestStartSessionSetsContentLengthHeader verifies that startSession sends
+// X-Goog-Upload-Header-Content-Length when given a known size, and omits it
+// when the size is unknown (0), so the server either pre-allocates the
+// resumable upload session or falls back to streaming mode as the protocol
+// requires.
+func TestStartSessionSetsContentLengthHeader(t *testing.T) {
+	var gotContentLength string
+	var sawHeader bool
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		gotContentLength = req.Header.Get("X-Goog-Upload-Header-Content-Length")
+		_, sawHeader = req.Header["X-Goog-Upload-Header-Content-Length"]
+		resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Header: make(http.Header)}
+		resp.Header.Set("X-Goog-Upload-URL", "https://content-push.googleapis.com/upload/session/1")
+		return resp, nil
+	})
+
+	u := NewUploader(&http.Client{Transport: transport}, UploadOptions{})
+
+	if _, err := u.startSession(context.Background(), "file.bin", 1234); err != nil {
+		t.Fatalf("startSession returned error: %v", err)
+	}
+	if !sawHeader || gotContentLength != "1234" {
+		t.Errorf("expected Content-Length header %q, got %q (present: %v)", "1234", gotContentLength, sawHeader)
+	}
+
+	if _, err := u.startSession(context.Background(), "file.bin", 0); err != nil {
+		t.Fatalf("startSession returned error: %v", err)
+	}
+	if sawHeader {
+		t.Errorf("expected no Content-Length header for unknown size, got %q", gotContentLength)
+	}
+}
+
+// TestSeekableSizeDetectsSizeAndRestoresPosition verifies that
+// seekableSize reports the remaining byte count for an io.Seeker and leaves
+// its read position unchanged, so Upload can size the session up front
+// without disturbing the subsequent chunk reads.
+func TestSeekableSizeDetectsSizeAndRestoresPosition(t *testing.T) {
+	r := bytes.NewReader([]byte("hello, resumable upload"))
+	if _, err := r.Seek(5, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+
+	size, err := seekableSize(r)
+	if err != nil {
+		t.Fatalf("seekableSize returned error: %v", err)
+	}
+	if want := int64(len("hello, resumable upload")) - 5; size != want {
+		t.Errorf("expected size %d, got %d", want, size)
+	}
+
+	pos, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	if pos != 5 {
+		t.Errorf("expected position restored to 5, got %d", pos)
+	}
+}
+
+// roundTripFunc adapts a func to an http.RoundTripper for stubbing
+// GeminiClient.Client in tests without a real network call.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// TestWithRetryRotatesOnceOnSessionExpiry verifies that an ErrorCodeSessionExpired
+// response (the "cookie expired" signature) triggers exactly one cookie
+// rotation and one transparent retry, independent of RetryPolicy.
+func TestWithRetryRotatesOnceOnSessionExpiry(t *testing.T) {
+	rotations := 0
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() != EndpointRotateCookies {
+			return nil, fmt.Errorf("unexpected request to %s", req.URL)
+		}
+		rotations++
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("")),
+			Header:     make(http.Header),
+		}
+		resp.Header.Add("Set-Cookie", "__Secure-1PSIDTS=new-value; Path=/")
+		return resp, nil
+	})
+
+	c := &GeminiClient{
+		Client:  &http.Client{Transport: transport},
+		Cookies: []*http.Cookie{{Name: "__Secure-1PSIDTS", Value: "old-value"}},
+	}
+
+	attempts := 0
+	err := c.withRetry(context.Background(), func() error {
+		attempts++
+		if attempts == 1 {
+			return &APIError{Code: ErrorCodeSessionExpired}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("withRetry returned error: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("expected attempt to be retried once after rotation, got %d attempts", attempts)
+	}
+	if rotations != 1 {
+		t.Errorf("expected exactly 1 rotation, got %d", rotations)
+	}
+	if got := c.Cookies[0].Value; got != "new-value" {
+		t.Errorf("expected cookie to be rotated to %q, got %q", "new-value", got)
+	}
+}
+
+// TestRotateAndPersistUpdatesClientJar is a regression test for
+// rotateAndPersist leaving c.Client.Jar holding the stale __Secure-1PSIDTS:
+// the rotate endpoint responds with a host-only Set-Cookie for
+// accounts.google.com, which the http.Client's own jar bookkeeping never
+// applies to google.com/gemini.google.com, so without an explicit
+// jar.SetCookies for those domains the live client keeps sending the dead
+// cookie on every subsequent Gemini request.
+func TestRotateAndPersistUpdatesClientJar(t *testing.T) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("cookiejar.New: %v", err)
+	}
+	uGemini, _ := url.Parse("https://gemini.google.com")
+	jar.SetCookies(uGemini, []*http.Cookie{{Name: "__Secure-1PSIDTS", Value: "old-value", Domain: ".google.com", Path: "/"}})
+
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("")),
+			Header:     make(http.Header),
+		}
+		resp.Header.Add("Set-Cookie", "__Secure-1PSIDTS=new-value; Path=/")
+		return resp, nil
+	})
+
+	c := &GeminiClient{
+		Client:  &http.Client{Jar: jar, Transport: transport},
+		Cookies: []*http.Cookie{{Name: "__Secure-1PSIDTS", Value: "old-value"}},
+	}
+
+	if err := c.rotateAndPersist(context.Background()); err != nil {
+		t.Fatalf("rotateAndPersist returned error: %v", err)
+	}
+
+	// Drive a real request through c.Client the way BatchExecute would, and
+	// confirm it actually sends the rotated cookie rather than the stale one.
+	var sentPSIDTS string
+	c.Client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		for _, ck := range req.Cookies() {
+			if ck.Name == "__Secure-1PSIDTS" {
+				sentPSIDTS = ck.Value
+			}
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Header: make(http.Header)}, nil
+	})
+	if _, err := c.Client.Get("https://gemini.google.com/app"); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if sentPSIDTS != "new-value" {
+		t.Errorf("expected subsequent request to send rotated cookie %q, got %q", "new-value", sentPSIDTS)
+	}
+}
+
+// TestCookieRotationMiddlewareRetriesOnce verifies the middleware rotates
+// and retries exactly once when the wrapped handler fails with
+// ErrorCodeSessionExpired, and passes through any other error unchanged.
+func TestCookieRotationMiddlewareRetriesOnce(t *testing.T) {
+	rotations := 0
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		rotations++
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("")),
+			Header:     make(http.Header),
+		}
+		resp.Header.Add("Set-Cookie", "__Secure-1PSIDTS=new-value; Path=/")
+		return resp, nil
+	})
+	c := &GeminiClient{Client: &http.Client{Transport: transport}}
+
+	calls := 0
+	handler := HandlerFunc(func(ctx context.Context, req *ChatRequest, w ResponseWriter) error {
+		calls++
+		if calls == 1 {
+			return &APIError{Code: ErrorCodeSessionExpired}
+		}
+		return nil
+	})
+
+	wrapped := CookieRotationMiddleware(c)(handler)
+	if err := wrapped.Serve(context.Background(), &ChatRequest{Prompt: "hi"}, nil); err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected handler to be retried once, got %d calls", calls)
+	}
+	if rotations != 1 {
+		t.Errorf("expected exactly 1 rotation, got %d", rotations)
+	}
+}
+
+// TestMemoryMiddlewareInjectsAndPersists verifies the middleware prefixes
+// the stored memory onto the prompt and saves the streamed reply as the new
+// memory, keyed by the chat's CID.
+func TestMemoryMiddlewareInjectsAndPersists(t *testing.T) {
+	store := newMemoryMapStore()
+	chat := &ChatSession{CID: "conv-1"}
+	if err := store.Save(context.Background(), chat.CID, "earlier context"); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	var gotPrompt string
+	handler := HandlerFunc(func(ctx context.Context, req *ChatRequest, w ResponseWriter) error {
+		gotPrompt = req.Prompt
+		return w.Write(ModelOutput{Candidates: []Candidate{{Text: "reply"}}})
+	})
+
+	wrapped := MemoryMiddleware(store)(handler)
+	var written []ModelOutput
+	w := writerFunc(func(out ModelOutput) error {
+		written = append(written, out)
+		return nil
+	})
+
+	if err := wrapped.Serve(context.Background(), &ChatRequest{Prompt: "next question", Chat: chat}, w); err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+	if gotPrompt != "earlier context\n\nnext question" {
+		t.Errorf("expected injected prompt, got %q", gotPrompt)
+	}
+
+	saved, err := store.Load(context.Background(), chat.CID)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if saved != "reply" {
+		t.Errorf("expected memory saved as %q, got %q", "reply", saved)
+	}
+}
+
+// writerFunc adapts a func to the ResponseWriter interface for tests.
+type writerFunc func(ModelOutput) error
+
+func (f writerFunc) Write(out ModelOutput) error { return f(out) }
+
+// memoryMapStore is a MemoryStore backed by an in-process map, used only in
+// tests.
+type memoryMapStore struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+// newMemoryMapStore creates an in-process MemoryStore for tests.
+func newMemoryMapStore() *memoryMapStore {
+	return &memoryMapStore{data: make(map[string]string)}
+}
+
+func (s *memoryMapStore) Load(ctx context.Context, conversationID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data[conversationID], nil
+}
+
+func (s *memoryMapStore) Save(ctx context.Context, conversationID string, memory string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[conversationID] = memory
+	return nil
+}
+
+// TestApiErrorFromBodyDetectsEmbeddedErrorCode verifies that a 200-status
+// body encoding Gemini's {"er": code} error signature is classified as
+// an *APIError with the code taken from the body, not guessed from the HTTP
+// status (which here is a plain 200).
+func TestApiErrorFromBodyDetectsEmbeddedErrorCode(t *testing.T) {
+	payload := `{"er":1037}`
+	body := ")]}'\n" + fmt.Sprintf("%d\n\n%s", len(payload)+2, payload)
+	apiErr, ok := apiErrorFromBody(body)
+	if !ok {
+		t.Fatalf("expected an embedded error to be detected")
+	}
+	if apiErr.Code != ErrorCodeUsageLimitExceeded {
+		t.Errorf("expected code %d, got %d", ErrorCodeUsageLimitExceeded, apiErr.Code)
+	}
+	if !apiErr.Code.IsRetryable() {
+		t.Errorf("expected ErrorCodeUsageLimitExceeded to be retryable")
+	}
+}
+
+// TestApiErrorFromBodyIgnoresOrdinaryFrames verifies that a body with no
+// embedded error signature isn't misclassified as one.
+func TestApiErrorFromBodyIgnoresOrdinaryFrames(t *testing.T) {
+	body := "5\n\n[1]\n5\n\n[2]"
+	if _, ok := apiErrorFromBody(body); ok {
+		t.Errorf("expected no embedded error to be detected")
+	}
+}
+
+// TestAcquireReleaseBoundsConcurrency verifies that WithMaxConcurrent(n)
+// never lets more than n acquire/release pairs run at once.
+func TestAcquireReleaseBoundsConcurrency(t *testing.T) {
+	c := &GeminiClient{}
+	WithMaxConcurrent(2)(c)
+
+	var active, maxActive int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.acquire(context.Background()); err != nil {
+				t.Errorf("acquire: %v", err)
+				return
+			}
+			defer c.release()
+
+			n := atomic.AddInt32(&active, 1)
+			for {
+				old := atomic.LoadInt32(&maxActive)
+				if n <= old || atomic.CompareAndSwapInt32(&maxActive, old, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&active, -1)
+		}()
+	}
+	wg.Wait()
+
+	if maxActive > 2 {
+		t.Errorf("expected at most 2 concurrent acquires, got %d", maxActive)
+	}
+}
+
+// TestBatchExecuteLockedDoesNotDeadlockOnHeldSlot is a regression test for
+// the chunk1-6 self-deadlock: GenerateContentStreamContext holds the one
+// WithMaxConcurrent(1) slot for its whole call, so its internal
+// bard_activity_enabled dispatches must go through
+// batchExecuteLocked (which doesn't acquire) rather than
+// BatchExecuteContext (which would block forever waiting on the slot it
+// already holds).
+func TestBatchExecuteLockedDoesNotDeadlockOnHeldSlot(t *testing.T) {
+	c := &GeminiClient{
+		Client: &http.Client{
+			Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				return nil, fmt.Errorf("network unreachable")
+			}),
+		},
+	}
+	WithMaxConcurrent(1)(c)
+
+	if err := c.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	defer c.release()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.batchExecuteLocked(context.Background(), nil)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("batchExecuteLocked deadlocked waiting on a concurrency slot the caller already holds")
+	}
+}
+
+// TestGenerateContentContextReturnsPromptlyOnCanceledContext is a regression
+// test for GenerateContentContext's unbuffered errChan: GenerateContentStreamContext
+// returning an error without ever sending to outChan (as acquire does on a
+// canceled context) used to make the goroutine block forever on
+// errChan <- err while the caller blocked forever on "for out := range outChan".
+func TestGenerateContentContextReturnsPromptlyOnCanceledContext(t *testing.T) {
+	c := &GeminiClient{}
+	WithMaxConcurrent(1)(c)
+
+	if err := c.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	defer c.release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	type result struct {
+		out ModelOutput
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := c.GenerateContentContext(ctx, "hi")
+		done <- result{out, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != ErrCanceled {
+			t.Errorf("expected ErrCanceled, got %v", r.err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("GenerateContentContext deadlocked instead of returning ErrCanceled")
+	}
+}
+
+// buildBatchExecFrameBody wraps record in the ")]}'\n" + length-prefixed
+// frame envelope BatchExecute responses use, so tests can stub a wrb.fr
+// record (e.g. ["wrb.fr", rpcid, innerJSON, ...]) without a real server.
+func buildBatchExecFrameBody(record []interface{}) string {
+	payload, _ := json.Marshal([]interface{}{record})
+	return ")]}'\n" + fmt.Sprintf("%d\n\n%s", len(payload)+2, payload)
+}
+
+// batchExecTransport stubs the http.Client used by a GeminiClient so any
+// request to EndpointBatchExec gets body as its response, the way a real
+// BatchExecute round trip would.
+func batchExecTransport(t *testing.T, body string) http.RoundTripper {
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if !strings.HasPrefix(req.URL.String(), EndpointBatchExec) {
+			t.Fatalf("unexpected request to %s", req.URL)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     make(http.Header),
+		}, nil
+	})
+}
+
+// TestChatSessionJSONRoundTrip verifies that MarshalJSON/UnmarshalJSON
+// preserve a ChatSession's CID/RID/RCID/Metadata/Model/Gem, and that
+// LoadChat restores the same fields with Client filled in.
+func TestChatSessionJSONRoundTrip(t *testing.T) {
+	original := &ChatSession{
+		CID:      "conv-1",
+		RID:      "r-1",
+		RCID:     "rc-1",
+		Metadata: []string{"conv-1", "r-1", "rc-1"},
+		Model:    ModelG30Pro,
+		Gem:      &Gem{ID: "gem-1"},
+	}
+
+	data, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	c := &GeminiClient{}
+	restored, err := c.LoadChat(data)
+	if err != nil {
+		t.Fatalf("LoadChat: %v", err)
+	}
+
+	if restored.Client != c {
+		t.Errorf("expected LoadChat to set Client")
+	}
+	if restored.CID != original.CID || restored.RID != original.RID || restored.RCID != original.RCID {
+		t.Errorf("expected CID/RID/RCID to round-trip, got %+v", restored)
+	}
+	if !reflect.DeepEqual(restored.Metadata, original.Metadata) {
+		t.Errorf("expected Metadata %v, got %v", original.Metadata, restored.Metadata)
+	}
+	if restored.Model.Name != ModelG30Pro.Name {
+		t.Errorf("expected Model %q, got %q", ModelG30Pro.Name, restored.Model.Name)
+	}
+	if restored.Gem == nil || restored.Gem.ID != "gem-1" {
+		t.Errorf("expected Gem.ID %q, got %+v", "gem-1", restored.Gem)
+	}
+}
+
+// TestListChatsContextParsesFrames verifies ListChatsContext extracts
+// CID/Title pairs from the nested wrb.fr frame BatchExecute returns.
+func TestListChatsContextParsesFrames(t *testing.T) {
+	inner := []interface{}{
+		[]interface{}{
+			[]interface{}{"cid-1", "First chat"},
+			[]interface{}{"cid-2", "Second chat"},
+		},
+	}
+	innerJSON, _ := json.Marshal(inner)
+	body := buildBatchExecFrameBody([]interface{}{"wrb.fr", GRPCListChats, string(innerJSON), nil, nil, nil, "generic"})
+
+	c := &GeminiClient{Client: &http.Client{Transport: batchExecTransport(t, body)}}
+
+	chats, err := c.ListChatsContext(context.Background())
+	if err != nil {
+		t.Fatalf("ListChatsContext: %v", err)
+	}
+	want := []ChatSummary{{CID: "cid-1", Title: "First chat"}, {CID: "cid-2", Title: "Second chat"}}
+	if !reflect.DeepEqual(chats, want) {
+		t.Errorf("expected %+v, got %+v", want, chats)
+	}
+}
+
+// TestDeleteChatContextSendsCID verifies DeleteChatContext sends cid as the
+// GRPCDeleteChat payload.
+func TestDeleteChatContextSendsCID(t *testing.T) {
+	var gotForm string
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if err := req.ParseForm(); err != nil {
+			t.Fatalf("ParseForm: %v", err)
+		}
+		gotForm = req.PostForm.Get("f.req")
+		body := buildBatchExecFrameBody([]interface{}{"wrb.fr", GRPCDeleteChat, "[1]", nil, nil, nil, "generic"})
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: make(http.Header)}, nil
+	})
+	c := &GeminiClient{Client: &http.Client{Transport: transport}}
+
+	if err := c.DeleteChatContext(context.Background(), "cid-1"); err != nil {
+		t.Fatalf("DeleteChatContext: %v", err)
+	}
+	if !strings.Contains(gotForm, "cid-1") {
+		t.Errorf("expected f.req to contain cid %q, got %q", "cid-1", gotForm)
+	}
+}
+
+// TestListGemsContextParsesFrames verifies ListGemsContext collects both
+// predefined and custom Gems, keyed by ID, from the nested wrb.fr frame.
+func TestListGemsContextParsesFrames(t *testing.T) {
+	inner := []interface{}{
+		[]interface{}{[]interface{}{"gem-predef", "Coder", "Writes code", "You are a coding assistant"}},
+		[]interface{}{[]interface{}{"gem-custom", "Poet", "Writes poems", "You are a poet"}},
+	}
+	innerJSON, _ := json.Marshal(inner)
+	body := buildBatchExecFrameBody([]interface{}{"wrb.fr", GRPCListGems, string(innerJSON), nil, nil, nil, "generic"})
+
+	c := &GeminiClient{Client: &http.Client{Transport: batchExecTransport(t, body)}}
+
+	jar, err := c.ListGemsContext(context.Background())
+	if err != nil {
+		t.Fatalf("ListGemsContext: %v", err)
+	}
+
+	want := GemJar{
+		"gem-predef": {ID: "gem-predef", Name: "Coder", Description: "Writes code", Prompt: "You are a coding assistant", Predefined: true},
+		"gem-custom": {ID: "gem-custom", Name: "Poet", Description: "Writes poems", Prompt: "You are a poet", Predefined: false},
+	}
+	if !reflect.DeepEqual(jar, want) {
+		t.Errorf("expected %+v, got %+v", want, jar)
+	}
+}
+
+// TestCreateGemContextReturnsAssignedID verifies CreateGemContext returns a
+// Gem populated with the ID the server assigned, alongside the fields the
+// caller supplied.
+func TestCreateGemContextReturnsAssignedID(t *testing.T) {
+	body := buildBatchExecFrameBody([]interface{}{"wrb.fr", GRPCCreateGem, `["gem-new"]`, nil, nil, nil, "generic"})
+	c := &GeminiClient{Client: &http.Client{Transport: batchExecTransport(t, body)}}
+
+	gem, err := c.CreateGemContext(context.Background(), "Poet", "You are a poet", "Writes poems")
+	if err != nil {
+		t.Fatalf("CreateGemContext: %v", err)
+	}
+	want := Gem{ID: "gem-new", Name: "Poet", Description: "Writes poems", Prompt: "You are a poet"}
+	if gem != want {
+		t.Errorf("expected %+v, got %+v", want, gem)
+	}
+}
+
+// TestUpdateGemContextRequiresID verifies UpdateGemContext rejects a Gem
+// with no ID rather than silently sending an update request to nothing.
+func TestUpdateGemContextRequiresID(t *testing.T) {
+	c := &GeminiClient{}
+	if err := c.UpdateGemContext(context.Background(), Gem{Name: "Poet"}); err == nil {
+		t.Error("expected an error for a Gem with no ID")
+	}
+}
+
+// TestDeleteGemContextSendsID verifies DeleteGemContext sends id as the
+// GRPCDeleteGem payload.
+func TestDeleteGemContextSendsID(t *testing.T) {
+	var gotForm string
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if err := req.ParseForm(); err != nil {
+			t.Fatalf("ParseForm: %v", err)
+		}
+		gotForm = req.PostForm.Get("f.req")
+		body := buildBatchExecFrameBody([]interface{}{"wrb.fr", GRPCDeleteGem, "[1]", nil, nil, nil, "generic"})
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: make(http.Header)}, nil
+	})
+	c := &GeminiClient{Client: &http.Client{Transport: transport}}
+
+	if err := c.DeleteGemContext(context.Background(), "gem-1"); err != nil {
+		t.Fatalf("DeleteGemContext: %v", err)
+	}
+	if !strings.Contains(gotForm, "gem-1") {
+		t.Errorf("expected f.req to contain id %q, got %q", "gem-1", gotForm)
+	}
+}
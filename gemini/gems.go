@@ -0,0 +1,129 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ListGems fetches both the predefined and the caller's custom Gems via
+// GRPCListGems, keyed by ID, with Gem.Predefined telling them apart.
+func (c *GeminiClient) ListGems() (GemJar, error) {
+	return c.ListGemsContext(context.Background())
+}
+
+// ListGemsContext is ListGems with a caller-supplied context.
+func (c *GeminiClient) ListGemsContext(ctx context.Context) (GemJar, error) {
+	body, err := c.BatchExecuteContext(ctx, []RPCData{{RPCID: GRPCListGems, Payload: "[0,1]"}})
+	if err != nil {
+		return nil, err
+	}
+
+	frames, err := ExtractJSONFromResponse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	jar := make(GemJar)
+	for _, frame := range frames {
+		innerStr, ok := GetNestedValue(frame, []interface{}{2}).(string)
+		if !ok {
+			continue
+		}
+		var inner []interface{}
+		if err := json.Unmarshal([]byte(innerStr), &inner); err != nil {
+			continue
+		}
+		for _, idx := range []int{0, 1} {
+			list, ok := GetNestedValue(inner, []interface{}{idx}).([]interface{})
+			if !ok {
+				continue
+			}
+			predefined := idx == 0
+			for _, item := range list {
+				id, _ := GetNestedValue(item, []interface{}{0}).(string)
+				if id == "" {
+					continue
+				}
+				name, _ := GetNestedValue(item, []interface{}{1}).(string)
+				description, _ := GetNestedValue(item, []interface{}{2}).(string)
+				prompt, _ := GetNestedValue(item, []interface{}{3}).(string)
+				jar[id] = Gem{
+					ID:          id,
+					Name:        name,
+					Description: description,
+					Prompt:      prompt,
+					Predefined:  predefined,
+				}
+			}
+		}
+	}
+
+	return jar, nil
+}
+
+// CreateGem creates a new custom Gem via GRPCCreateGem.
+func (c *GeminiClient) CreateGem(name, prompt, description string) (Gem, error) {
+	return c.CreateGemContext(context.Background(), name, prompt, description)
+}
+
+// CreateGemContext is CreateGem with a caller-supplied context.
+func (c *GeminiClient) CreateGemContext(ctx context.Context, name, prompt, description string) (Gem, error) {
+	payload, _ := json.Marshal([]interface{}{name, description, prompt})
+	body, err := c.BatchExecuteContext(ctx, []RPCData{{RPCID: GRPCCreateGem, Payload: string(payload)}})
+	if err != nil {
+		return Gem{}, err
+	}
+
+	frames, err := ExtractJSONFromResponse(body)
+	if err != nil {
+		return Gem{}, err
+	}
+
+	for _, frame := range frames {
+		innerStr, ok := GetNestedValue(frame, []interface{}{2}).(string)
+		if !ok {
+			continue
+		}
+		var inner []interface{}
+		if err := json.Unmarshal([]byte(innerStr), &inner); err != nil {
+			continue
+		}
+		id, _ := GetNestedValue(inner, []interface{}{0}).(string)
+		if id == "" {
+			continue
+		}
+		return Gem{ID: id, Name: name, Description: description, Prompt: prompt}, nil
+	}
+
+	return Gem{}, fmt.Errorf("gemini: create gem response did not contain a gem id")
+}
+
+// UpdateGem updates an existing custom Gem identified by g.ID via
+// GRPCUpdateGem. g.Name, g.Prompt, and g.Description replace the Gem's
+// current values.
+func (c *GeminiClient) UpdateGem(g Gem) error {
+	return c.UpdateGemContext(context.Background(), g)
+}
+
+// UpdateGemContext is UpdateGem with a caller-supplied context.
+func (c *GeminiClient) UpdateGemContext(ctx context.Context, g Gem) error {
+	if g.ID == "" {
+		return fmt.Errorf("gemini: UpdateGem requires a non-empty Gem.ID")
+	}
+	payload, _ := json.Marshal([]interface{}{g.ID, g.Name, g.Description, g.Prompt})
+	_, err := c.BatchExecuteContext(ctx, []RPCData{{RPCID: GRPCUpdateGem, Payload: string(payload)}})
+	return err
+}
+
+// DeleteGem deletes the custom Gem identified by id via GRPCDeleteGem.
+func (c *GeminiClient) DeleteGem(id string) error {
+	return c.DeleteGemContext(context.Background(), id)
+}
+
+// DeleteGemContext is DeleteGem with a caller-supplied context.
+func (c *GeminiClient) DeleteGemContext(ctx context.Context, id string) error {
+	payload, _ := json.Marshal([]interface{}{id})
+	_, err := c.BatchExecuteContext(ctx, []RPCData{{RPCID: GRPCDeleteGem, Payload: string(payload)}})
+	return err
+}
@@ -0,0 +1,169 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// chatSessionJSON is the wire format ChatSession's MarshalJSON/UnmarshalJSON
+// use to serialize a conversation for later resumption.
+type chatSessionJSON struct {
+	CID      string   `json:"cid"`
+	RID      string   `json:"rid"`
+	RCID     string   `json:"rcid"`
+	Metadata []string `json:"metadata"`
+	Model    string   `json:"model,omitempty"`
+	GemID    string   `json:"gem_id,omitempty"`
+}
+
+// MarshalJSON serializes the conversation's CID/RID/RCID/Metadata/Model/Gem
+// so it can be persisted and later restored with GeminiClient.LoadChat. The
+// Model is stored by name and the Gem by ID only; its other fields are not
+// kept.
+func (s *ChatSession) MarshalJSON() ([]byte, error) {
+	wire := chatSessionJSON{
+		CID:      s.CID,
+		RID:      s.RID,
+		RCID:     s.RCID,
+		Metadata: s.Metadata,
+		Model:    s.Model.Name,
+	}
+	if s.Gem != nil {
+		wire.GemID = s.Gem.ID
+	}
+	return json.Marshal(wire)
+}
+
+// UnmarshalJSON restores a conversation previously serialized with
+// MarshalJSON. Client is left unset; LoadChat fills it in.
+func (s *ChatSession) UnmarshalJSON(data []byte) error {
+	var wire chatSessionJSON
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+
+	s.CID = wire.CID
+	s.RID = wire.RID
+	s.RCID = wire.RCID
+	s.Metadata = wire.Metadata
+	if m, ok := ModelFromName(wire.Model); ok {
+		s.Model = m
+	}
+	if wire.GemID != "" {
+		s.Gem = &Gem{ID: wire.GemID}
+	}
+	return nil
+}
+
+// LoadChat reconstructs a ChatSession previously saved with
+// json.Marshal(chat), so a conversation can resume across process restarts.
+func (c *GeminiClient) LoadChat(data []byte) (*ChatSession, error) {
+	chat := &ChatSession{Client: c}
+	if err := json.Unmarshal(data, chat); err != nil {
+		return nil, err
+	}
+	return chat, nil
+}
+
+// ChatSummary is one entry in the list returned by ListChats.
+type ChatSummary struct {
+	CID   string
+	Title string
+}
+
+// ListChats fetches the caller's server-side chat history via GRPCListChats.
+func (c *GeminiClient) ListChats() ([]ChatSummary, error) {
+	return c.ListChatsContext(context.Background())
+}
+
+// ListChatsContext is ListChats with a caller-supplied context.
+func (c *GeminiClient) ListChatsContext(ctx context.Context) ([]ChatSummary, error) {
+	body, err := c.BatchExecuteContext(ctx, []RPCData{{RPCID: GRPCListChats, Payload: "[null,1]"}})
+	if err != nil {
+		return nil, err
+	}
+
+	frames, err := ExtractJSONFromResponse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var chats []ChatSummary
+	for _, frame := range frames {
+		innerStr, ok := GetNestedValue(frame, []interface{}{2}).(string)
+		if !ok {
+			continue
+		}
+		var inner []interface{}
+		if err := json.Unmarshal([]byte(innerStr), &inner); err != nil {
+			continue
+		}
+		list, ok := GetNestedValue(inner, []interface{}{0}).([]interface{})
+		if !ok {
+			continue
+		}
+		for _, item := range list {
+			cid, _ := GetNestedValue(item, []interface{}{0}).(string)
+			if cid == "" {
+				continue
+			}
+			title, _ := GetNestedValue(item, []interface{}{1}).(string)
+			chats = append(chats, ChatSummary{CID: cid, Title: title})
+		}
+	}
+
+	return chats, nil
+}
+
+// DeleteChat deletes the server-side chat history identified by cid via
+// GRPCDeleteChat.
+func (c *GeminiClient) DeleteChat(cid string) error {
+	return c.DeleteChatContext(context.Background(), cid)
+}
+
+// DeleteChatContext is DeleteChat with a caller-supplied context.
+func (c *GeminiClient) DeleteChatContext(ctx context.Context, cid string) error {
+	payload, _ := json.Marshal([]interface{}{cid})
+	_, err := c.BatchExecuteContext(ctx, []RPCData{{RPCID: GRPCDeleteChat, Payload: string(payload)}})
+	return err
+}
+
+// ReadChat replays the previous turns of the server-side chat identified by
+// cid (and optionally rid, for a specific reply) into a []ModelOutput, via
+// GRPCReadChat.
+func (c *GeminiClient) ReadChat(cid, rid string) ([]ModelOutput, error) {
+	return c.ReadChatContext(context.Background(), cid, rid)
+}
+
+// ReadChatContext is ReadChat with a caller-supplied context.
+func (c *GeminiClient) ReadChatContext(ctx context.Context, cid, rid string) ([]ModelOutput, error) {
+	payload, _ := json.Marshal([]interface{}{cid, rid})
+	body, err := c.BatchExecuteContext(ctx, []RPCData{{RPCID: GRPCReadChat, Payload: string(payload)}})
+	if err != nil {
+		return nil, err
+	}
+
+	frames, err := ExtractJSONFromResponse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	lastTexts := make(map[string]string)
+	lastThoughts := make(map[string]string)
+
+	var outputs []ModelOutput
+	for _, frame := range frames {
+		parsed, err := processFrame(frame, nil, lastTexts, lastThoughts, c.Proxy)
+		if err != nil {
+			continue
+		}
+		outputs = append(outputs, parsed...)
+	}
+
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("no chat history found for cid %q", cid)
+	}
+
+	return outputs, nil
+}
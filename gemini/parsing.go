@@ -1,8 +1,10 @@
 package gemini
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
 	"regexp"
 	"strconv"
 	"strings"
@@ -288,3 +290,124 @@ func ExtractJSONFromResponse(text string) ([]interface{}, error) {
 
 	return nil, fmt.Errorf("could not find valid JSON")
 }
+
+// defaultScanBufferSize is how many bytes FrameScanner reads from its
+// underlying reader per fill, independent of any individual frame's size.
+const defaultScanBufferSize = 4096
+
+// FrameScanner incrementally parses Google's length-prefixed frame protocol
+// from an io.Reader, in the style of bufio.Scanner: call Scan in a loop,
+// read Frame after each true result, and check Err once Scan returns false.
+// Unlike ParseResponseByFrame, it never re-parses bytes it has already
+// consumed, so a streaming reply is parsed in O(N) instead of being
+// re-scanned on every delta.
+type FrameScanner struct {
+	r       *bufio.Reader
+	chunk   []byte
+	buffer  string
+	pending []interface{}
+	frame   interface{}
+	err     error
+	done    bool
+}
+
+// NewFrameScanner wraps r in a FrameScanner. If r is already a *bufio.Reader
+// it is used as-is.
+func NewFrameScanner(r io.Reader) *FrameScanner {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &FrameScanner{r: br, chunk: make([]byte, defaultScanBufferSize)}
+}
+
+// Scan advances the scanner to the next frame, which Frame then returns. It
+// returns false once the underlying reader is exhausted or returns an error,
+// which Err then reports.
+func (s *FrameScanner) Scan() bool {
+	if s.done {
+		return false
+	}
+
+	for len(s.pending) == 0 {
+		if !s.fill() {
+			return false
+		}
+	}
+
+	s.frame, s.pending = s.pending[0], s.pending[1:]
+	return true
+}
+
+// frameNotYetComplete reports whether buffer's leading length-prefixed
+// frame is provably still incomplete, without paying for the UTF-16 rune
+// count ParseResponseByFrame(buffer) would otherwise redo from the start of
+// the buffer on every call. It's a cheap necessary (not sufficient) check:
+// a frame's declared length counts UTF-16 units, and a UTF-8 string never
+// has fewer bytes than UTF-16 units, so if the bytes available after the
+// length marker already fall short of the declared length, the frame can't
+// be complete yet and there's no point re-scanning the buffer for it.
+func frameNotYetComplete(buffer string) bool {
+	start := 0
+	for start < len(buffer) && isSpace(buffer[start]) {
+		start++
+	}
+
+	match := lengthMarkerPattern.FindStringSubmatch(buffer[start:])
+	if match == nil {
+		return false
+	}
+
+	length, _ := strconv.Atoi(match[1])
+	contentStart := start + len(match[1])
+	return len(buffer)-contentStart < length
+}
+
+// fill reads more bytes from the underlying reader and tries to parse at
+// least one new frame out of the accumulated buffer, preserving any
+// trailing partial frame across reads. While a single frame is known to
+// still be incomplete (see frameNotYetComplete), it skips the buffered
+// reparse and just accumulates more bytes, so one large frame arriving over
+// many small reads costs O(N) overall instead of O(N^2).
+func (s *FrameScanner) fill() bool {
+	for {
+		if !frameNotYetComplete(s.buffer) {
+			frames, remaining := ParseResponseByFrame(s.buffer)
+			s.buffer = remaining
+			if len(frames) > 0 {
+				s.pending = frames
+				return true
+			}
+		}
+
+		n, err := s.r.Read(s.chunk)
+		if n > 0 {
+			s.buffer += string(s.chunk[:n])
+			if strings.HasPrefix(s.buffer, ")]}'") {
+				s.buffer = s.buffer[4:]
+				s.buffer = strings.TrimLeft(s.buffer, " \t\n\r")
+			}
+			continue
+		}
+
+		if err == io.EOF {
+			s.done = true
+			return false
+		}
+		if err != nil {
+			s.err = err
+			s.done = true
+			return false
+		}
+	}
+}
+
+// Frame returns the frame produced by the most recent call to Scan.
+func (s *FrameScanner) Frame() interface{} {
+	return s.frame
+}
+
+// Err returns the first non-EOF error encountered while reading, if any.
+func (s *FrameScanner) Err() error {
+	return s.err
+}
@@ -0,0 +1,65 @@
+package gemini
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// ClientOption configures optional behavior on a GeminiClient at
+// construction time, via NewClient's variadic opts parameter.
+type ClientOption func(*GeminiClient)
+
+// WithRateLimit bounds outgoing requests to rps requests per second, with
+// bursts up to burst, using a token-bucket limiter. Only the call that
+// dispatches a request waits for a token; a streaming response does not
+// hold it for the stream's duration. Gemini returns ErrorCodeUsageLimitExceeded
+// (1037) quickly when hammered, so this is the first line of defense before
+// RetryPolicy kicks in.
+func WithRateLimit(rps float64, burst int) ClientOption {
+	return func(c *GeminiClient) {
+		c.limiter = rate.NewLimiter(rate.Limit(rps), burst)
+	}
+}
+
+// WithMaxConcurrent bounds the number of in-flight BatchExecute/
+// GenerateContentStream calls to n. Unlike the rate limiter, a streaming
+// call holds its slot until the stream closes, since that's the resource
+// actually being bounded (open connections, not just dispatch rate).
+func WithMaxConcurrent(n int) ClientOption {
+	return func(c *GeminiClient) {
+		c.sem = make(chan struct{}, n)
+	}
+}
+
+// acquire waits for both the rate limiter (if configured) and a concurrency
+// slot (if configured) before a request is dispatched. Callers must pair a
+// successful acquire with release.
+func (c *GeminiClient) acquire(ctx context.Context) error {
+	if c.limiter != nil {
+		if err := c.limiter.WaitN(ctx, 1); err != nil {
+			if ctx.Err() != nil {
+				return ErrCanceled
+			}
+			return err
+		}
+	}
+
+	if c.sem != nil {
+		select {
+		case c.sem <- struct{}{}:
+		case <-ctx.Done():
+			return ErrCanceled
+		}
+	}
+
+	return nil
+}
+
+// release frees the concurrency slot acquired by acquire, if one was
+// configured.
+func (c *GeminiClient) release() {
+	if c.sem != nil {
+		<-c.sem
+	}
+}
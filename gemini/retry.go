@@ -0,0 +1,211 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// APIError is returned by BatchExecuteContext and GenerateContentStreamContext
+// when the response encodes one of the recognized ErrorCode statuses, so
+// callers (and RetryPolicy) can branch on Code instead of parsing a
+// fmt.Errorf string.
+type APIError struct {
+	Code       ErrorCode
+	Status     string
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("gemini: request failed with code %d (status: %s)", e.Code, e.Status)
+}
+
+// IsRetryable reports whether c is one of the transient codes a RetryPolicy
+// retries by default (1013 temporary error, 1037 usage limit exceeded), as
+// opposed to permanent failures like an invalid model header (1052) or a
+// blocked IP (1060).
+func (c ErrorCode) IsRetryable() bool {
+	switch c {
+	case ErrorCodeTemporaryError1013, ErrorCodeUsageLimitExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// apiErrorFromResponse classifies a non-200 response into the ErrorCode
+// Google uses for it. Only statuses that are unambiguous about the
+// underlying condition are mapped this way (429 is always a rate limit,
+// 502/503/504 are always a gateway/transient failure, 401 is always an
+// unauthenticated session); anything else falls back to a plain
+// fmt.Errorf, as before typed errors existed. Application-level codes like
+// 1050/1052/1060 aren't guessable from an HTTP status at all — this API's
+// convention is to embed them in the response body (see errorFromFrame),
+// even alongside a 200 status.
+func apiErrorFromResponse(resp *http.Response) error {
+	var code ErrorCode
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		code = ErrorCodeUsageLimitExceeded
+	case http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusGatewayTimeout:
+		code = ErrorCodeTemporaryError1013
+	case http.StatusUnauthorized:
+		code = ErrorCodeSessionExpired
+	default:
+		return fmt.Errorf("gemini: request failed with status: %s", resp.Status)
+	}
+
+	apiErr := &APIError{Code: code, Status: resp.Status}
+	if ra := resp.Header.Get("Retry-After"); ra != "" {
+		if secs, err := strconv.Atoi(ra); err == nil {
+			apiErr.RetryAfter = time.Duration(secs) * time.Second
+		}
+	}
+	return apiErr
+}
+
+// errorFromFrame reports whether frame is this API's embedded error
+// signature, a JSON object of the form {"er": code}. ParseResponseByFrame
+// only flattens top-level JSON lists (see TestParseResponseByFrame), so an
+// object survives as a single frame, letting this check run per-frame the
+// same way FrameScanner already hands frames to processFrame. Gemini uses
+// it to report ErrorCode failures (e.g. 1037 usage limit, 1060 blocked IP)
+// inside an otherwise-200 response, so BatchExecuteContext and
+// GenerateContentStreamContext check every frame for it instead of only
+// classifying errors off the HTTP status.
+func errorFromFrame(frame interface{}) (*APIError, bool) {
+	m, ok := frame.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	codeNum, ok := m["er"].(float64)
+	if !ok {
+		return nil, false
+	}
+	return &APIError{Code: ErrorCode(codeNum)}, true
+}
+
+// apiErrorFromBody scans body's parsed frames for the embedded error
+// signature errorFromFrame recognizes, for callers (like
+// BatchExecuteContext) that buffer the whole response instead of scanning
+// it frame by frame.
+func apiErrorFromBody(body string) (*APIError, bool) {
+	frames, err := ExtractJSONFromResponse(body)
+	if err != nil {
+		return nil, false
+	}
+	for _, frame := range frames {
+		if apiErr, ok := errorFromFrame(frame); ok {
+			return apiErr, true
+		}
+	}
+	return nil, false
+}
+
+// defaultInitialBackoff and defaultMaxBackoff back RetryPolicy fields left
+// unset by the caller.
+const (
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 30 * time.Second
+)
+
+// DefaultRetryPolicy is a reasonable RetryPolicy for callers that want to
+// opt in without tuning every field: c.RetryPolicy = gemini.DefaultRetryPolicy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:     3,
+	InitialBackoff: defaultInitialBackoff,
+	MaxBackoff:     defaultMaxBackoff,
+}
+
+// RetryPolicy configures automatic retry of transient errors for
+// BatchExecuteContext and GenerateContentStreamContext (only before any
+// output has been streamed). The zero value disables retries.
+type RetryPolicy struct {
+	// MaxRetries is the number of retry attempts after the first try. 0
+	// disables retries entirely.
+	MaxRetries int
+	// InitialBackoff is the delay before the first retry; it doubles after
+	// each subsequent failure, capped at MaxBackoff. Defaults to 500ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the exponential backoff between retries. Defaults to
+	// 30s.
+	MaxBackoff time.Duration
+	// RetryableCodes overrides which ErrorCodes are retried. If empty,
+	// ErrorCode.IsRetryable is used.
+	RetryableCodes []ErrorCode
+}
+
+func (p RetryPolicy) retryable(code ErrorCode) bool {
+	if len(p.RetryableCodes) == 0 {
+		return code.IsRetryable()
+	}
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// withRetry runs attempt, retrying per c.RetryPolicy when attempt returns an
+// *APIError with a retryable code. It honors APIError.RetryAfter when
+// present, otherwise backs off exponentially with jitter. attempt is
+// responsible for building a fresh request each call, since an *http.Request
+// can't be replayed.
+//
+// Independently of RetryPolicy, an ErrorCodeSessionExpired response (the
+// server's "cookie expired" signature) forces one cookie rotation and one
+// transparent retry, since no amount of backoff fixes a stale cookie.
+func (c *GeminiClient) withRetry(ctx context.Context, attempt func() error) error {
+	policy := c.RetryPolicy
+	backoff := policy.InitialBackoff
+	if backoff <= 0 {
+		backoff = defaultInitialBackoff
+	}
+	maxBackoff := policy.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	rotatedOnExpiry := false
+
+	for try := 0; ; try++ {
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Code == ErrorCodeSessionExpired && !rotatedOnExpiry {
+			rotatedOnExpiry = true
+			if rerr := c.rotateAndPersist(ctx); rerr == nil {
+				continue
+			}
+			return err
+		}
+
+		if !errors.As(err, &apiErr) || !policy.retryable(apiErr.Code) || try >= policy.MaxRetries {
+			return err
+		}
+
+		wait := apiErr.RetryAfter
+		if wait <= 0 {
+			wait = backoff
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+		jitter := time.Duration(rand.Int63n(int64(wait)/4 + 1))
+
+		select {
+		case <-ctx.Done():
+			return ErrCanceled
+		case <-time.After(wait + jitter):
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// ChatRequest is the input a Mux dispatches to a matched Handler.
+type ChatRequest struct {
+	Prompt string
+	Chat   *ChatSession
+	Opts   []Option
+}
+
+// ResponseWriter receives streamed ModelOutput deltas from a Handler, the
+// way http.ResponseWriter receives an HTTP handler's output.
+type ResponseWriter interface {
+	Write(ModelOutput) error
+}
+
+// Handler serves a single chat request, optionally streaming output to w.
+type Handler interface {
+	Serve(ctx context.Context, req *ChatRequest, w ResponseWriter) error
+}
+
+// HandlerFunc adapts a plain function to the Handler interface.
+type HandlerFunc func(ctx context.Context, req *ChatRequest, w ResponseWriter) error
+
+func (f HandlerFunc) Serve(ctx context.Context, req *ChatRequest, w ResponseWriter) error {
+	return f(ctx, req, w)
+}
+
+// Middleware wraps a Handler to add cross-cutting behavior (logging, rate
+// limiting, cookie rotation, redaction) without touching the transport code.
+type Middleware func(Handler) Handler
+
+// ChatHandler is the terminal Handler backed by ChatSession, mirroring what
+// Chat.SendMessage/SendMessageStream already do.
+type ChatHandler struct {
+	Chat *ChatSession
+}
+
+func (h ChatHandler) Serve(ctx context.Context, req *ChatRequest, w ResponseWriter) error {
+	if w == nil {
+		_, err := h.Chat.SendMessageContext(ctx, req.Prompt, req.Opts...)
+		return err
+	}
+
+	outChan := make(chan ModelOutput)
+	errChan := make(chan error, 1)
+
+	go func() {
+		defer close(outChan)
+		errChan <- h.Chat.SendMessageStreamContext(ctx, req.Prompt, outChan, req.Opts...)
+	}()
+
+	for out := range outChan {
+		if err := w.Write(out); err != nil {
+			return err
+		}
+	}
+
+	return <-errChan
+}
+
+// Mux dispatches chat requests to handlers registered against prompt
+// patterns, applying middleware in registration order around every match.
+type Mux struct {
+	mu          sync.RWMutex
+	routes      []route
+	middlewares []Middleware
+}
+
+type route struct {
+	pattern *regexp.Regexp
+	handler Handler
+}
+
+// NewMux creates an empty Mux.
+func NewMux() *Mux {
+	return &Mux{}
+}
+
+// Use registers middleware applied, in registration order, around every
+// handler Serve dispatches to.
+func (m *Mux) Use(mw Middleware) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.middlewares = append(m.middlewares, mw)
+}
+
+// Handle registers handler for prompts matching pattern, a regexp. The
+// pattern is not anchored: a match anywhere in the prompt selects handler.
+func (m *Mux) Handle(pattern string, handler Handler) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.routes = append(m.routes, route{pattern: re, handler: handler})
+	return nil
+}
+
+// HandleFunc is the HandlerFunc equivalent of Handle.
+func (m *Mux) HandleFunc(pattern string, fn HandlerFunc) error {
+	return m.Handle(pattern, fn)
+}
+
+// Serve dispatches req to the first registered handler whose pattern
+// matches req.Prompt, wrapped by every registered middleware. If nothing
+// matches, fallback is used as the terminal handler.
+func (m *Mux) Serve(ctx context.Context, req *ChatRequest, w ResponseWriter, fallback Handler) error {
+	handler := m.match(req.Prompt)
+	if handler == nil {
+		handler = fallback
+	}
+	if handler == nil {
+		return fmt.Errorf("gemini: no handler matched prompt %q and no fallback was provided", req.Prompt)
+	}
+
+	m.mu.RLock()
+	mws := append([]Middleware(nil), m.middlewares...)
+	m.mu.RUnlock()
+
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
+	}
+
+	return handler.Serve(ctx, req, w)
+}
+
+func (m *Mux) match(prompt string) Handler {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, r := range m.routes {
+		if r.pattern.MatchString(prompt) {
+			return r.handler
+		}
+	}
+	return nil
+}
+
+// LoggingMiddleware logs the prompt and resulting error (if any) of every
+// request it wraps, using logger (e.g. log.Printf).
+func LoggingMiddleware(logger func(format string, args ...interface{})) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *ChatRequest, w ResponseWriter) error {
+			logger("gemini: serving prompt %q", req.Prompt)
+			err := next.Serve(ctx, req, w)
+			if err != nil {
+				logger("gemini: prompt %q failed: %v", req.Prompt, err)
+			}
+			return err
+		})
+	}
+}
+
+// RateLimitMiddleware bounds dispatch of the requests it wraps to limiter's
+// token bucket, the same primitive WithRateLimit configures on a
+// GeminiClient, so a Mux-based service can share one limiter across routes.
+func RateLimitMiddleware(limiter *rate.Limiter) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *ChatRequest, w ResponseWriter) error {
+			if err := limiter.Wait(ctx); err != nil {
+				if ctx.Err() != nil {
+					return ErrCanceled
+				}
+				return err
+			}
+			return next.Serve(ctx, req, w)
+		})
+	}
+}
+
+// CookieRotationMiddleware retries a request once, after forcing a cookie
+// rotation, when the wrapped handler fails with ErrorCodeSessionExpired (the
+// server's "cookie expired" signature). It is the router-layer counterpart
+// of the rotate-and-retry withRetry already does for BatchExecuteContext and
+// GenerateContentStreamContext, for handlers that can fail the same way
+// without going through either.
+func CookieRotationMiddleware(c *GeminiClient) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *ChatRequest, w ResponseWriter) error {
+			err := next.Serve(ctx, req, w)
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Code != ErrorCodeSessionExpired {
+				return err
+			}
+
+			if rerr := c.rotateAndPersist(ctx); rerr != nil {
+				return err
+			}
+			return next.Serve(ctx, req, w)
+		})
+	}
+}
+
+// MemoryStore persists free-form per-conversation context (e.g. a running
+// summary) that MemoryMiddleware injects into later turns of the same
+// conversation.
+type MemoryStore interface {
+	Load(ctx context.Context, conversationID string) (string, error)
+	Save(ctx context.Context, conversationID string, memory string) error
+}
+
+// MemoryMiddleware prefixes req.Prompt with the memory stored for req.Chat's
+// conversation (keyed by ChatSession.CID), then persists the chosen
+// candidate's text as the new memory once the handler returns. Requests
+// without a Chat, or whose Chat hasn't been assigned a CID yet (the first
+// turn of a new conversation), pass through unchanged. Since the updated
+// memory is read from the streamed output, it's only persisted when w is
+// non-nil; a nil w (buffered dispatch) still gets the injected prompt but
+// skips the save.
+func MemoryMiddleware(store MemoryStore) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *ChatRequest, w ResponseWriter) error {
+			if req.Chat == nil || req.Chat.CID == "" {
+				return next.Serve(ctx, req, w)
+			}
+
+			memory, err := store.Load(ctx, req.Chat.CID)
+			if err != nil {
+				return err
+			}
+
+			injected := *req
+			if memory != "" {
+				injected.Prompt = memory + "\n\n" + req.Prompt
+			}
+
+			if w == nil {
+				return next.Serve(ctx, &injected, w)
+			}
+
+			capture := &lastOutputWriter{next: w}
+			if err := next.Serve(ctx, &injected, capture); err != nil {
+				return err
+			}
+			return store.Save(ctx, req.Chat.CID, capture.last.Text())
+		})
+	}
+}
+
+// lastOutputWriter forwards every write to next while remembering the most
+// recent ModelOutput, so MemoryMiddleware can persist it once streaming ends.
+type lastOutputWriter struct {
+	next ResponseWriter
+	last ModelOutput
+}
+
+func (w *lastOutputWriter) Write(out ModelOutput) error {
+	w.last = out
+	return w.next.Write(out)
+}
+
+// ImageSaveMiddleware saves every image in each streamed ModelOutput to dir
+// before forwarding it to the wrapped ResponseWriter, using cookies to
+// authenticate the fetch when Gemini requires the session that generated
+// the image.
+func ImageSaveMiddleware(dir string, cookies []*http.Cookie) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, req *ChatRequest, w ResponseWriter) error {
+			if w == nil {
+				return next.Serve(ctx, req, w)
+			}
+			return next.Serve(ctx, req, &imageSavingWriter{next: w, dir: dir, cookies: cookies})
+		})
+	}
+}
+
+// imageSavingWriter forwards every write to next after saving its images to
+// disk.
+type imageSavingWriter struct {
+	next    ResponseWriter
+	dir     string
+	cookies []*http.Cookie
+}
+
+func (w *imageSavingWriter) Write(out ModelOutput) error {
+	for _, img := range out.Images() {
+		if _, err := img.Save(w.dir, "", w.cookies, true); err != nil {
+			return err
+		}
+	}
+	return w.next.Write(out)
+}
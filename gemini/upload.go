@@ -0,0 +1,307 @@
+package gemini
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultChunkSize is the chunk size Uploader uses when UploadOptions.ChunkSize is unset.
+const DefaultChunkSize = 8 * 1024 * 1024 // 8 MiB
+
+// UploadOptions configures a resumable upload performed by Uploader.
+type UploadOptions struct {
+	// ChunkSize is the number of bytes sent per chunk request. Defaults to DefaultChunkSize.
+	ChunkSize int
+	// Compress gzip-compresses each chunk before sending it.
+	Compress bool
+	// MaxRetries is the number of retries per chunk on a 5xx response or a
+	// failed connection. Defaults to 3.
+	MaxRetries int
+}
+
+// Uploader drives Google's resumable upload protocol, sending a file in
+// bounded-size chunks instead of buffering it whole like UploadFile does.
+type Uploader struct {
+	Client  *http.Client
+	Options UploadOptions
+}
+
+// NewUploader creates an Uploader, filling in defaults for unset options.
+func NewUploader(client *http.Client, opts UploadOptions) *Uploader {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultChunkSize
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = 3
+	}
+	return &Uploader{Client: client, Options: opts}
+}
+
+// UploadFileStream uploads r via the resumable upload protocol and returns
+// the opaque file handle from the server's final response, without ever
+// buffering more than one chunk of r in memory. WithFiles treats a string
+// as a local file path, so it does not accept this handle.
+func (c *GeminiClient) UploadFileStream(ctx context.Context, r io.Reader, name string, opts UploadOptions) (string, error) {
+	return NewUploader(c.Client, opts).Upload(ctx, r, name)
+}
+
+// Upload streams r to Google's upload endpoint in chunks of at most
+// u.Options.ChunkSize bytes, resuming from the server-reported offset if a
+// chunk fails partway through. If r is an io.Seeker (e.g. an *os.File), its
+// size is sent as X-Goog-Upload-Header-Content-Length on the start request
+// so the server can pre-allocate the session; otherwise that header is
+// omitted. In both cases the upload is finalized by the last chunk's
+// "upload, finalize" command.
+func (u *Uploader) Upload(ctx context.Context, r io.Reader, name string) (string, error) {
+	size, err := seekableSize(r)
+	if err != nil {
+		return "", err
+	}
+
+	uploadURL, err := u.startSession(ctx, name, size)
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, u.Options.ChunkSize)
+	var offset int64
+
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if readErr != nil && readErr != io.ErrUnexpectedEOF && readErr != io.EOF {
+			return "", readErr
+		}
+		final := readErr == io.EOF || readErr == io.ErrUnexpectedEOF
+
+		if n == 0 && !final {
+			continue
+		}
+
+		handle, newOffset, err := u.sendChunkWithRetry(ctx, uploadURL, buf[:n], offset, final)
+		if err != nil {
+			return "", err
+		}
+		offset = newOffset
+
+		if final {
+			return handle, nil
+		}
+	}
+}
+
+// seekableSize returns the total size of r if it's an io.Seeker, restoring
+// its current position afterward, or 0 with no error if the size can't be
+// determined up front (the caller streamed a bare io.Reader).
+func seekableSize(r io.Reader) (int64, error) {
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return 0, nil
+	}
+
+	cur, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := seeker.Seek(cur, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	return end - cur, nil
+}
+
+// startSession opens a resumable upload session and returns the per-upload
+// URL the server assigns for subsequent chunk requests. size is sent as
+// X-Goog-Upload-Header-Content-Length so the server can pre-allocate the
+// session; a size of 0 means unknown, and the header is then omitted rather
+// than claiming an empty file.
+func (u *Uploader) startSession(ctx context.Context, name string, size int64) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", EndpointUpload, nil)
+	if err != nil {
+		return "", err
+	}
+
+	for k, v := range HeadersUpload {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("X-Goog-Upload-Command", "start")
+	req.Header.Set("X-Goog-Upload-Protocol", "resumable")
+	req.Header.Set("X-Goog-Upload-Header-Content-Type", "application/octet-stream")
+	req.Header.Set("X-Goog-Upload-File-Name", name)
+	if size > 0 {
+		req.Header.Set("X-Goog-Upload-Header-Content-Length", strconv.FormatInt(size, 10))
+	}
+
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("failed to start resumable upload, status: %s", resp.Status)
+	}
+
+	uploadURL := resp.Header.Get("X-Goog-Upload-URL")
+	if uploadURL == "" {
+		return "", fmt.Errorf("server did not return an upload URL")
+	}
+
+	return uploadURL, nil
+}
+
+// sendChunkWithRetry sends one chunk, retrying on a 5xx response or a
+// failed connection with exponential backoff. If the server reports it already received part of
+// the chunk before a dropped connection, it resumes from that offset by
+// resending only the unreceived tail instead of the whole chunk.
+func (u *Uploader) sendChunkWithRetry(ctx context.Context, uploadURL string, chunk []byte, offset int64, final bool) (string, int64, error) {
+	var lastErr error
+
+	origOffset := offset
+	pending := chunk
+
+	for attempt := 0; attempt <= u.Options.MaxRetries; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(math.Pow(2, float64(attempt))) * 100 * time.Millisecond
+			backoff += time.Duration(rand.Int63n(int64(backoff)/2 + 1))
+			select {
+			case <-ctx.Done():
+				return "", offset, ctx.Err()
+			case <-time.After(backoff):
+			}
+
+			if queried, qerr := u.queryOffset(ctx, uploadURL); qerr == nil && queried > origOffset {
+				sent := queried - origOffset
+				if sent > int64(len(chunk)) {
+					sent = int64(len(chunk))
+				}
+				offset = queried
+				pending = chunk[sent:]
+			}
+		}
+
+		handle, status, err := u.putChunk(ctx, uploadURL, pending, offset, final)
+		if err == nil {
+			return handle, origOffset + int64(len(chunk)), nil
+		}
+		lastErr = err
+
+		// status 0 means no response was received (e.g. a dropped
+		// connection), which is retried like a 5xx.
+		if status != 0 && (status < 500 || status >= 600) {
+			return "", offset, err
+		}
+	}
+
+	return "", offset, fmt.Errorf("upload chunk failed after %d attempts: %w", u.Options.MaxRetries+1, lastErr)
+}
+
+// putChunk wraps chunk in a multipart body, optionally gzip-compressed, fed
+// through an io.Pipe so the request never buffers more than one chunk, and
+// PUTs it at the given offset.
+func (u *Uploader) putChunk(ctx context.Context, uploadURL string, chunk []byte, offset int64, final bool) (string, int, error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	go func() {
+		part, err := mw.CreateFormFile("chunk", "chunk")
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		var dst io.Writer = part
+		var gz *gzip.Writer
+		if u.Options.Compress {
+			gz = gzip.NewWriter(part)
+			dst = gz
+		}
+
+		if _, err := dst.Write(chunk); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if gz != nil {
+			if err := gz.Close(); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		if err := mw.Close(); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.Close()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", uploadURL, pr)
+	if err != nil {
+		return "", 0, err
+	}
+
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("X-Goog-Upload-Offset", strconv.FormatInt(offset, 10))
+	if u.Options.Compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if final {
+		req.Header.Set("X-Goog-Upload-Command", "upload, finalize")
+	} else {
+		req.Header.Set("X-Goog-Upload-Command", "upload")
+	}
+
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", resp.StatusCode, fmt.Errorf("upload chunk failed with status: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", resp.StatusCode, err
+	}
+
+	return string(body), resp.StatusCode, nil
+}
+
+// queryOffset asks the server how many bytes of the current session it has
+// received, so an interrupted upload can resume without resending data.
+func (u *Uploader) queryOffset(ctx context.Context, uploadURL string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "PUT", uploadURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("X-Goog-Upload-Command", "query")
+
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return 0, fmt.Errorf("failed to query upload offset, status: %s", resp.Status)
+	}
+
+	received, err := strconv.ParseInt(resp.Header.Get("X-Goog-Upload-Size-Received"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("server did not return a valid upload offset: %w", err)
+	}
+
+	return received, nil
+}
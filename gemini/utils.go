@@ -2,6 +2,7 @@ package gemini
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"math/rand"
@@ -29,6 +30,12 @@ func ParseFileName(file interface{}) (string, error) {
 }
 
 func UploadFile(client *http.Client, file interface{}, filename string) (string, error) {
+	return UploadFileContext(context.Background(), client, file, filename)
+}
+
+// UploadFileContext is UploadFile with a caller-supplied context, threaded
+// into the outbound HTTP request via http.NewRequestWithContext.
+func UploadFileContext(ctx context.Context, client *http.Client, file interface{}, filename string) (string, error) {
 	var fileContent []byte
 	var err error
 
@@ -73,7 +80,7 @@ func UploadFile(client *http.Client, file interface{}, filename string) (string,
 		return "", err
 	}
 
-	req, err := http.NewRequest("POST", EndpointUpload, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", EndpointUpload, body)
 	if err != nil {
 		return "", err
 	}